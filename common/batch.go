@@ -0,0 +1,121 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/MixinNetwork/mixin/crypto"
+)
+
+// Batch validates a set of SignedTransactions that may depend on each
+// other's outputs, e.g. a wallet building tx B that spends a change output
+// of tx A before A has been confirmed. Transactions are topologically
+// sorted by input->output dependency and validated in that order, with
+// earlier transactions' outputs exposed to later ones through a
+// PendingUTXOResolver.
+type Batch struct {
+	Transactions []*SignedTransaction
+}
+
+// NewBatch wraps txs for dependency-aware validation. The order of txs does
+// not need to respect dependencies, Validate sorts them itself.
+func NewBatch(txs []*SignedTransaction) *Batch {
+	return &Batch{Transactions: txs}
+}
+
+// Validate topologically sorts the batch and validates every transaction in
+// order, resolving inputs that spend outputs of an earlier transaction in
+// the same batch against an in-memory pending set instead of the confirmed
+// UTXO pool. A dependency cycle, or any single invalid transaction, fails
+// the whole batch.
+func (b *Batch) Validate(lockUTXOForTransaction UTXOLocker, checkGhost GhostChecker) error {
+	ordered, err := b.sorted()
+	if err != nil {
+		return err
+	}
+
+	pendingOutputs := make(map[string]*UTXO)
+	for _, tx := range ordered {
+		hash := tx.Hash()
+		// pending consumes the entry it resolves, so a second transaction in
+		// the batch spending the same not-yet-confirmed output fails to
+		// resolve it and falls through to the (equally empty) confirmed
+		// pool, rejecting the in-batch double-spend.
+		pending := func(h crypto.Hash, index int) (*UTXO, error) {
+			key := fmt.Sprintf("%s:%d", h.String(), index)
+			utxo, ok := pendingOutputs[key]
+			if !ok {
+				return nil, nil
+			}
+			delete(pendingOutputs, key)
+			return utxo, nil
+		}
+
+		err := tx.ValidatePending(lockUTXOForTransaction, checkGhost, pending)
+		if err != nil {
+			return fmt.Errorf("invalid transaction %s in batch: %v", hash.String(), err)
+		}
+
+		for i, o := range tx.Outputs {
+			utxo := &UTXO{
+				Input:  Input{Hash: hash, Index: i},
+				Output: *o,
+				Asset:  tx.Asset,
+				Lock:   pendingOutputLock(o),
+			}
+			pendingOutputs[fmt.Sprintf("%s:%d", hash.String(), i)] = utxo
+		}
+	}
+	return nil
+}
+
+// sorted returns the batch's transactions ordered so that every transaction
+// appears after any other batch transaction whose output it spends, using
+// Kahn's algorithm over the input->output dependency graph.
+func (b *Batch) sorted() ([]*SignedTransaction, error) {
+	byHash := make(map[string]*SignedTransaction, len(b.Transactions))
+	for _, tx := range b.Transactions {
+		byHash[tx.Hash().String()] = tx
+	}
+
+	dependents := make(map[string][]string)
+	indegree := make(map[string]int)
+	for _, tx := range b.Transactions {
+		h := tx.Hash().String()
+		if _, ok := indegree[h]; !ok {
+			indegree[h] = 0
+		}
+		for _, in := range tx.Inputs {
+			dh := in.Hash.String()
+			if _, ok := byHash[dh]; !ok {
+				continue
+			}
+			dependents[dh] = append(dependents[dh], h)
+			indegree[h]++
+		}
+	}
+
+	queue := make([]string, 0, len(b.Transactions))
+	for h, n := range indegree {
+		if n == 0 {
+			queue = append(queue, h)
+		}
+	}
+
+	ordered := make([]*SignedTransaction, 0, len(b.Transactions))
+	for len(queue) > 0 {
+		h := queue[0]
+		queue = queue[1:]
+		ordered = append(ordered, byHash[h])
+		for _, d := range dependents[h] {
+			indegree[d]--
+			if indegree[d] == 0 {
+				queue = append(queue, d)
+			}
+		}
+	}
+
+	if len(ordered) != len(b.Transactions) {
+		return nil, fmt.Errorf("invalid batch with circular transaction dependency")
+	}
+	return ordered, nil
+}
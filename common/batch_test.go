@@ -0,0 +1,211 @@
+package common
+
+import (
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/MixinNetwork/mixin/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatch(t *testing.T) {
+	assert := assert.New(t)
+
+	accounts := make([]Address, 0)
+	for i := 0; i < 2; i++ {
+		accounts = append(accounts, randomAccount())
+	}
+
+	seed := make([]byte, 64)
+	rand.Read(seed)
+	genesisHash := crypto.Hash{}
+	script := Script{OperatorCmp, OperatorSum, 1}
+
+	utxoLocker := func(hash crypto.Hash, index int, tx crypto.Hash, lock uint64) (*UTXO, error) {
+		genesisMaskr := crypto.NewKeyFromSeed(seed)
+		genesisMaskR := genesisMaskr.Public()
+
+		in := Input{Hash: hash, Index: index}
+		out := Output{
+			Type:   OutputTypeScript,
+			Amount: NewInteger(10000),
+			Script: script,
+			Mask:   genesisMaskR,
+		}
+		utxo := &UTXO{Input: in, Output: out, Asset: XINAssetId}
+		key := crypto.DeriveGhostPublicKey(&genesisMaskr, &accounts[0].PublicViewKey, &accounts[0].PublicSpendKey)
+		utxo.Keys = append(utxo.Keys, *key)
+		return utxo, nil
+	}
+	keyChecker := func(key crypto.Key) (bool, error) {
+		return false, nil
+	}
+
+	txA := NewTransaction(XINAssetId)
+	txA.AddInput(genesisHash, 0)
+	txA.AddScriptOutput(accounts[:1], script, NewInteger(10000))
+	signedA := &SignedTransaction{Transaction: *txA}
+	assert.Nil(signedA.SignInput(utxoLocker, 0, accounts[:1]))
+	assert.Nil(signedA.Validate(utxoLocker, keyChecker))
+
+	pendingFromA := func(hash crypto.Hash, index int) (*UTXO, error) {
+		if hash.String() != signedA.Hash().String() || index >= len(signedA.Outputs) {
+			return nil, nil
+		}
+		return &UTXO{
+			Input:  Input{Hash: hash, Index: index},
+			Output: *signedA.Outputs[index],
+			Asset:  signedA.Asset,
+		}, nil
+	}
+
+	txB := NewTransaction(XINAssetId)
+	txB.AddInput(signedA.Hash(), 0)
+	txB.AddScriptOutput(accounts[:1], script, NewInteger(10000))
+	signedB := &SignedTransaction{Transaction: *txB}
+	assert.Nil(signedB.SignInputPending(utxoLocker, 0, accounts[:1], pendingFromA))
+
+	batch := NewBatch([]*SignedTransaction{signedB, signedA})
+	ordered, err := batch.sorted()
+	assert.Nil(err)
+	if assert.Len(ordered, 2) {
+		assert.Equal(signedA.Hash(), ordered[0].Hash())
+		assert.Equal(signedB.Hash(), ordered[1].Hash())
+	}
+
+	err = batch.Validate(func(hash crypto.Hash, index int, tx crypto.Hash, lock uint64) (*UTXO, error) {
+		if hash.String() == signedA.Hash().String() {
+			return nil, fmt.Errorf("txB's input must resolve via the batch's pending set, not the confirmed pool")
+		}
+		return utxoLocker(hash, index, tx, lock)
+	}, keyChecker)
+	assert.Nil(err)
+}
+
+func TestBatchRejectsInBatchDoubleSpend(t *testing.T) {
+	assert := assert.New(t)
+
+	accounts := make([]Address, 0)
+	for i := 0; i < 2; i++ {
+		accounts = append(accounts, randomAccount())
+	}
+
+	seed := make([]byte, 64)
+	rand.Read(seed)
+	genesisHash := crypto.Hash{}
+	script := Script{OperatorCmp, OperatorSum, 1}
+
+	utxoLocker := func(hash crypto.Hash, index int, tx crypto.Hash, lock uint64) (*UTXO, error) {
+		genesisMaskr := crypto.NewKeyFromSeed(seed)
+		genesisMaskR := genesisMaskr.Public()
+
+		in := Input{Hash: hash, Index: index}
+		out := Output{
+			Type:   OutputTypeScript,
+			Amount: NewInteger(10000),
+			Script: script,
+			Mask:   genesisMaskR,
+		}
+		utxo := &UTXO{Input: in, Output: out, Asset: XINAssetId}
+		key := crypto.DeriveGhostPublicKey(&genesisMaskr, &accounts[0].PublicViewKey, &accounts[0].PublicSpendKey)
+		utxo.Keys = append(utxo.Keys, *key)
+		return utxo, nil
+	}
+	keyChecker := func(key crypto.Key) (bool, error) {
+		return false, nil
+	}
+
+	txA := NewTransaction(XINAssetId)
+	txA.AddInput(genesisHash, 0)
+	txA.AddScriptOutput(accounts[:1], script, NewInteger(10000))
+	signedA := &SignedTransaction{Transaction: *txA}
+	assert.Nil(signedA.SignInput(utxoLocker, 0, accounts[:1]))
+	assert.Nil(signedA.Validate(utxoLocker, keyChecker))
+
+	pendingFromA := func(hash crypto.Hash, index int) (*UTXO, error) {
+		if hash.String() != signedA.Hash().String() || index >= len(signedA.Outputs) {
+			return nil, nil
+		}
+		return &UTXO{
+			Input:  Input{Hash: hash, Index: index},
+			Output: *signedA.Outputs[index],
+			Asset:  signedA.Asset,
+		}, nil
+	}
+
+	newSpendOfA := func() *SignedTransaction {
+		tx := NewTransaction(XINAssetId)
+		tx.AddInput(signedA.Hash(), 0)
+		tx.AddScriptOutput(accounts[:1], script, NewInteger(10000))
+		signed := &SignedTransaction{Transaction: *tx}
+		assert.Nil(signed.SignInputPending(utxoLocker, 0, accounts[:1], pendingFromA))
+		return signed
+	}
+	signedB1 := newSpendOfA()
+	signedB2 := newSpendOfA()
+
+	confirmedPool := func(hash crypto.Hash, index int, tx crypto.Hash, lock uint64) (*UTXO, error) {
+		if hash.String() == signedA.Hash().String() {
+			return nil, nil
+		}
+		return utxoLocker(hash, index, tx, lock)
+	}
+
+	batch := NewBatch([]*SignedTransaction{signedA, signedB1, signedB2})
+	err := batch.Validate(confirmedPool, keyChecker)
+	assert.NotNil(err, "two sibling transactions spending the same in-batch output must not both validate")
+}
+
+func TestBatchRejectsSameBatchVoteRevoke(t *testing.T) {
+	assert := assert.New(t)
+
+	account := randomAccount()
+	votee := crypto.NewHash([]byte("validator"))
+	script := Script{OperatorCmp, OperatorSum, 1}
+
+	seed := make([]byte, 64)
+	rand.Read(seed)
+	genesisHash := crypto.Hash{}
+
+	utxoLocker := func(hash crypto.Hash, index int, tx crypto.Hash, lock uint64) (*UTXO, error) {
+		genesisMaskr := crypto.NewKeyFromSeed(seed)
+		genesisMaskR := genesisMaskr.Public()
+		in := Input{Hash: hash, Index: index}
+		out := Output{Type: OutputTypeScript, Amount: NewInteger(10000), Script: script, Mask: genesisMaskR}
+		utxo := &UTXO{Input: in, Output: out, Asset: XINAssetId}
+		key := crypto.DeriveGhostPublicKey(&genesisMaskr, &account.PublicViewKey, &account.PublicSpendKey)
+		utxo.Keys = append(utxo.Keys, *key)
+		return utxo, nil
+	}
+	keyChecker := func(key crypto.Key) (bool, error) {
+		return false, nil
+	}
+
+	stake := NewTransaction(XINAssetId)
+	stake.AddInput(genesisHash, 0)
+	assert.Nil(stake.AddVoteOutput(account, script, votee, NewInteger(10000)))
+	signedStake := &SignedTransaction{Transaction: *stake}
+	assert.Nil(signedStake.SignInput(utxoLocker, 0, []Address{account}))
+
+	pendingFromStake := func(hash crypto.Hash, index int) (*UTXO, error) {
+		if hash.String() != signedStake.Hash().String() || index >= len(signedStake.Outputs) {
+			return nil, nil
+		}
+		return &UTXO{
+			Input:  Input{Hash: hash, Index: index},
+			Output: *signedStake.Outputs[index],
+			Asset:  signedStake.Asset,
+		}, nil
+	}
+
+	revoke := NewTransaction(XINAssetId)
+	revoke.AddRevokeInput(signedStake.Hash(), 0)
+	assert.Nil(revoke.AddScriptOutput([]Address{account}, script, NewInteger(10000)))
+	signedRevoke := &SignedTransaction{Transaction: *revoke}
+	assert.Nil(signedRevoke.SignInputPending(utxoLocker, 0, []Address{account}, pendingFromStake))
+
+	batch := NewBatch([]*SignedTransaction{signedStake, signedRevoke})
+	err := batch.Validate(utxoLocker, keyChecker)
+	assert.NotNil(err, "a vote staked and revoked within the same batch must still respect VoteEpoch, not read as already unlocked")
+}
@@ -0,0 +1,130 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/MixinNetwork/mixin/crypto"
+)
+
+const (
+	BundleMagic   = "MIXINBEEF"
+	BundleVersion = 0x01
+)
+
+// MerkleProof proves that a transaction hash was included in the snapshot
+// tree rooted at SnapshotHash for the given Height, by walking Siblings
+// from the leaf at Index up to the root.
+type MerkleProof struct {
+	Height       uint64        `msgpack:"H"json:"height"`
+	SnapshotHash crypto.Hash   `msgpack:"R"json:"snapshot_hash"`
+	Siblings     []crypto.Hash `msgpack:"S"json:"siblings"`
+	Index        uint64        `msgpack:"X"json:"index"`
+}
+
+// Verify recomputes the Merkle root from leaf by walking Siblings and
+// reports whether it matches SnapshotHash.
+func (p *MerkleProof) Verify(leaf crypto.Hash) bool {
+	index, hash := p.Index, leaf
+	for _, sibling := range p.Siblings {
+		buf := make([]byte, 0, len(hash)+len(sibling))
+		if index%2 == 0 {
+			buf = append(append(buf, hash[:]...), sibling[:]...)
+		} else {
+			buf = append(append(buf, sibling[:]...), hash[:]...)
+		}
+		hash = crypto.NewHash(buf)
+		index /= 2
+	}
+	return hash.String() == p.SnapshotHash.String()
+}
+
+// Bundle is a BEEF-style self-contained transaction package: a Target
+// transaction together with all of its Ancestors and a Merkle inclusion
+// Proof for each ancestor (matched by slice index) against a snapshot root
+// the receiver already trusts, so Target can be validated entirely offline.
+type Bundle struct {
+	Magic     string               `msgpack:"M"json:"magic"`
+	Version   uint8                `msgpack:"V"json:"version"`
+	Ancestors []*SignedTransaction `msgpack:"A"json:"ancestors"`
+	Proofs    []*MerkleProof       `msgpack:"P"json:"proofs"`
+	Target    *SignedTransaction   `msgpack:"T"json:"target"`
+}
+
+// NewBundle packages target with its ancestors and their matching inclusion
+// proofs, Proofs[i] must prove Ancestors[i].
+func NewBundle(target *SignedTransaction, ancestors []*SignedTransaction, proofs []*MerkleProof) *Bundle {
+	return &Bundle{
+		Magic:     BundleMagic,
+		Version:   BundleVersion,
+		Ancestors: ancestors,
+		Proofs:    proofs,
+		Target:    target,
+	}
+}
+
+func (b *Bundle) Marshal() []byte {
+	return MsgpackMarshalPanic(b)
+}
+
+// UnmarshalBundle decodes a Bundle previously produced by Marshal and
+// rejects an unrecognized magic or version before the caller ever looks at
+// its contents.
+func UnmarshalBundle(data []byte) (*Bundle, error) {
+	var b Bundle
+	err := MsgpackUnmarshal(data, &b)
+	if err != nil {
+		return nil, err
+	}
+	if b.Magic != BundleMagic {
+		return nil, fmt.Errorf("invalid bundle magic %s", b.Magic)
+	}
+	if b.Version != BundleVersion {
+		return nil, fmt.Errorf("invalid bundle version %d", b.Version)
+	}
+	return &b, nil
+}
+
+// Verify lets a receiver accept Target using only a list of snapshot roots
+// it already trusts, no live node required. Every ancestor's inclusion
+// proof is checked against trustedSnapshotRoots, then Target is validated
+// against the UTXO set reconstructed from the ancestors' outputs.
+func (b *Bundle) Verify(trustedSnapshotRoots func(height uint64) crypto.Hash) error {
+	if b.Target == nil {
+		return fmt.Errorf("invalid bundle without a target transaction")
+	}
+	if len(b.Ancestors) != len(b.Proofs) {
+		return fmt.Errorf("invalid bundle ancestor/proof count %d %d", len(b.Ancestors), len(b.Proofs))
+	}
+
+	pendingOutputs := make(map[string]*UTXO)
+	for i, tx := range b.Ancestors {
+		hash := tx.Hash()
+		proof := b.Proofs[i]
+		root := trustedSnapshotRoots(proof.Height)
+		if root.String() != proof.SnapshotHash.String() {
+			return fmt.Errorf("untrusted snapshot root at height %d", proof.Height)
+		}
+		if !proof.Verify(hash) {
+			return fmt.Errorf("ancestor %s fails its inclusion proof", hash.String())
+		}
+		for index, o := range tx.Outputs {
+			pendingOutputs[fmt.Sprintf("%s:%d", hash.String(), index)] = &UTXO{
+				Input:  Input{Hash: hash, Index: index},
+				Output: *o,
+				Asset:  tx.Asset,
+				Lock:   pendingOutputLock(o),
+			}
+		}
+	}
+
+	pending := func(hash crypto.Hash, index int) (*UTXO, error) {
+		return pendingOutputs[fmt.Sprintf("%s:%d", hash.String(), index)], nil
+	}
+	noLiveNode := func(hash crypto.Hash, index int, tx crypto.Hash, lock uint64) (*UTXO, error) {
+		return nil, nil
+	}
+	noGhostCheck := func(key crypto.Key) (bool, error) {
+		return false, nil
+	}
+	return b.Target.ValidatePending(noLiveNode, noGhostCheck, pending)
+}
@@ -0,0 +1,153 @@
+package common
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/MixinNetwork/mixin/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerkleProof(t *testing.T) {
+	assert := assert.New(t)
+
+	leaf := crypto.NewHash([]byte("leaf"))
+	sibling := crypto.NewHash([]byte("sibling"))
+	root := crypto.NewHash(append(append([]byte{}, leaf[:]...), sibling[:]...))
+
+	proof := &MerkleProof{Height: 1, SnapshotHash: root, Siblings: []crypto.Hash{sibling}, Index: 0}
+	assert.True(proof.Verify(leaf))
+
+	proof.Index = 1
+	assert.False(proof.Verify(leaf), "a proof built for the wrong leaf position must not verify")
+}
+
+func TestBundle(t *testing.T) {
+	assert := assert.New(t)
+
+	accounts := make([]Address, 0)
+	for i := 0; i < 2; i++ {
+		accounts = append(accounts, randomAccount())
+	}
+
+	seed := make([]byte, 64)
+	rand.Read(seed)
+	script := Script{OperatorCmp, OperatorSum, 1}
+
+	scriptLocker := func(hash crypto.Hash, index int, tx crypto.Hash, lock uint64) (*UTXO, error) {
+		maskr := crypto.NewKeyFromSeed(seed)
+		maskR := maskr.Public()
+		in := Input{Hash: hash, Index: index}
+		out := Output{Type: OutputTypeScript, Amount: NewInteger(10000), Script: script, Mask: maskR}
+		utxo := &UTXO{Input: in, Output: out, Asset: XINAssetId}
+		key := crypto.DeriveGhostPublicKey(&maskr, &accounts[0].PublicViewKey, &accounts[0].PublicSpendKey)
+		utxo.Keys = append(utxo.Keys, *key)
+		return utxo, nil
+	}
+
+	ancestor := NewTransaction(XINAssetId)
+	ancestor.AddInput(crypto.Hash{}, 0)
+	assert.Nil(ancestor.AddScriptOutput(accounts[:1], script, NewInteger(10000)))
+	signedAncestor := &SignedTransaction{Transaction: *ancestor}
+	assert.Nil(signedAncestor.SignInput(scriptLocker, 0, accounts[:1]))
+	assert.Nil(signedAncestor.Validate(scriptLocker, func(crypto.Key) (bool, error) { return false, nil }))
+
+	target := NewTransaction(XINAssetId)
+	target.AddInput(signedAncestor.Hash(), 0)
+	assert.Nil(target.AddScriptOutput(accounts[:1], script, NewInteger(10000)))
+	signedTarget := &SignedTransaction{Transaction: *target}
+	pending := func(hash crypto.Hash, index int) (*UTXO, error) {
+		if hash.String() != signedAncestor.Hash().String() {
+			return nil, nil
+		}
+		return &UTXO{
+			Input:  Input{Hash: hash, Index: index},
+			Output: *signedAncestor.Outputs[index],
+			Asset:  signedAncestor.Asset,
+		}, nil
+	}
+	assert.Nil(signedTarget.SignInputPending(scriptLocker, 0, accounts[:1], pending))
+
+	ancestorHash := signedAncestor.Hash()
+	root := ancestorHash
+	proof := &MerkleProof{Height: 7, SnapshotHash: root, Siblings: nil, Index: 0}
+	assert.True(proof.Verify(ancestorHash))
+
+	bundle := NewBundle(signedTarget, []*SignedTransaction{signedAncestor}, []*MerkleProof{proof})
+	data := bundle.Marshal()
+	decoded, err := UnmarshalBundle(data)
+	assert.Nil(err)
+	assert.Equal(bundle.Target.Hash(), decoded.Target.Hash())
+
+	trustedRoots := func(height uint64) crypto.Hash {
+		if height == 7 {
+			return root
+		}
+		return crypto.Hash{}
+	}
+	assert.Nil(decoded.Verify(trustedRoots))
+
+	untrustedRoots := func(height uint64) crypto.Hash {
+		return crypto.Hash{}
+	}
+	assert.NotNil(decoded.Verify(untrustedRoots), "a bundle whose snapshot root is not trusted must not verify")
+}
+
+func TestBundleRejectsImmediateVoteRevoke(t *testing.T) {
+	assert := assert.New(t)
+
+	account := randomAccount()
+	votee := crypto.NewHash([]byte("validator"))
+	script := Script{OperatorCmp, OperatorSum, 1}
+
+	seed := make([]byte, 64)
+	rand.Read(seed)
+
+	scriptLocker := func(hash crypto.Hash, index int, tx crypto.Hash, lock uint64) (*UTXO, error) {
+		maskr := crypto.NewKeyFromSeed(seed)
+		maskR := maskr.Public()
+		in := Input{Hash: hash, Index: index}
+		out := Output{Type: OutputTypeScript, Amount: NewInteger(10000), Script: script, Mask: maskR}
+		utxo := &UTXO{Input: in, Output: out, Asset: XINAssetId}
+		key := crypto.DeriveGhostPublicKey(&maskr, &account.PublicViewKey, &account.PublicSpendKey)
+		utxo.Keys = append(utxo.Keys, *key)
+		return utxo, nil
+	}
+
+	ancestor := NewTransaction(XINAssetId)
+	ancestor.AddInput(crypto.Hash{}, 0)
+	assert.Nil(ancestor.AddVoteOutput(account, script, votee, NewInteger(10000)))
+	signedAncestor := &SignedTransaction{Transaction: *ancestor}
+	assert.Nil(signedAncestor.SignInput(scriptLocker, 0, []Address{account}))
+
+	target := NewTransaction(XINAssetId)
+	target.AddRevokeInput(signedAncestor.Hash(), 0)
+	assert.Nil(target.AddScriptOutput([]Address{account}, script, NewInteger(10000)))
+	signedTarget := &SignedTransaction{Transaction: *target}
+	pending := func(hash crypto.Hash, index int) (*UTXO, error) {
+		if hash.String() != signedAncestor.Hash().String() {
+			return nil, nil
+		}
+		return &UTXO{
+			Input:  Input{Hash: hash, Index: index},
+			Output: *signedAncestor.Outputs[index],
+			Asset:  signedAncestor.Asset,
+		}, nil
+	}
+	assert.Nil(signedTarget.SignInputPending(scriptLocker, 0, []Address{account}, pending))
+
+	ancestorHash := signedAncestor.Hash()
+	root := ancestorHash
+	proof := &MerkleProof{Height: 9, SnapshotHash: root, Siblings: nil, Index: 0}
+	assert.True(proof.Verify(ancestorHash))
+
+	bundle := NewBundle(signedTarget, []*SignedTransaction{signedAncestor}, []*MerkleProof{proof})
+	trustedRoots := func(height uint64) crypto.Hash {
+		if height == 9 {
+			return root
+		}
+		return crypto.Hash{}
+	}
+	err := bundle.Verify(trustedRoots)
+	assert.NotNil(err, "a vote output created by a bundled ancestor must still respect VoteEpoch before the target can revoke it")
+}
@@ -0,0 +1,218 @@
+package common
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/MixinNetwork/mixin/crypto"
+)
+
+// UTXOSource supplies spendable UTXOs of asset held by any of accounts, e.g.
+// backed by a wallet's local UTXO cache or a node query. A SpendAction calls
+// it to select inputs, the returned UTXOs should be ordered so the cheapest
+// selection (e.g. fewest, largest first) comes first.
+type UTXOSource interface {
+	ListUnspent(ctx context.Context, asset crypto.Hash, accounts []Address) ([]*UTXO, error)
+}
+
+// Template accumulates what TxBuilder has gathered so far: the transaction
+// under construction, which accounts are allowed to sign each input, and
+// the UTXOs backing those inputs, keyed for TxBuilder.Build's signing pass.
+type Template struct {
+	Transaction *Transaction
+	Signers     [][]Address
+	utxos       map[string]*UTXO
+}
+
+// AddInput records utxo as a new transaction input and accounts as the
+// parties allowed to sign it.
+func (t *Template) AddInput(utxo *UTXO, accounts []Address) {
+	t.Transaction.AddInput(utxo.Input.Hash, utxo.Input.Index)
+	t.Signers = append(t.Signers, accounts)
+	t.utxos[fmt.Sprintf("%s:%d", utxo.Input.Hash.String(), utxo.Input.Index)] = utxo
+}
+
+// SetExtra writes extra to the transaction's single shared Extra slot. Extra
+// has room for only one action's data, so SetExtra fails loudly rather than
+// silently overwriting an earlier action's contribution when two actions in
+// the same TxBuilder both need it.
+func (t *Template) SetExtra(extra []byte) error {
+	if len(t.Transaction.Extra) > 0 {
+		return fmt.Errorf("transaction extra already set, only one action per TxBuilder may use it")
+	}
+	t.Transaction.Extra = extra
+	return nil
+}
+
+// Action declares one piece of intent a TxBuilder folds into a Template.
+// Third parties can register new action types, e.g. a future VoteAction
+// that stakes a selected input, by implementing Action without touching
+// TxBuilder itself.
+type Action interface {
+	Apply(ctx context.Context, tpl *Template, source UTXOSource) error
+}
+
+// SpendAction selects enough unspent Asset outputs held by From to cover
+// Amount, adding them as transaction inputs and registering From as the
+// accounts allowed to sign them. Because UTXOs rarely sum to exactly
+// Amount, it also pays any overselected remainder straight back to From as
+// a change output, so combining several SpendActions from different
+// sources in one TxBuilder never misattributes one source's change to
+// another.
+type SpendAction struct {
+	Asset  crypto.Hash
+	Amount Integer
+	From   []Address
+}
+
+func (a *SpendAction) Apply(ctx context.Context, tpl *Template, source UTXOSource) error {
+	utxos, err := source.ListUnspent(ctx, a.Asset, a.From)
+	if err != nil {
+		return err
+	}
+
+	var collected Integer
+	need := a.Amount
+	for _, utxo := range utxos {
+		if need.Sign() <= 0 {
+			break
+		}
+		tpl.AddInput(utxo, a.From)
+		collected = collected.Add(utxo.Amount)
+		need = need.Sub(utxo.Amount)
+	}
+	if need.Sign() > 0 {
+		return fmt.Errorf("insufficient unspent %s outputs to cover %s", a.Asset.String(), a.Amount.String())
+	}
+
+	if change := collected.Sub(a.Amount); change.Sign() > 0 {
+		err := tpl.Transaction.AddScriptOutput(a.From, defaultChangeScript, change)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendAction pays Amount to To, locked by Script.
+type SendAction struct {
+	To     []Address
+	Script Script
+	Amount Integer
+}
+
+func (a *SendAction) Apply(ctx context.Context, tpl *Template, source UTXOSource) error {
+	return tpl.Transaction.AddScriptOutput(a.To, a.Script, a.Amount)
+}
+
+// PledgeAction locks Amount into a node pledge output for Node, the public
+// key of the node being pledged to. OutputTypePledge carries no dedicated
+// field for this, so Node travels in the transaction's Extra, which is the
+// only place a pledge output's node identity can be recovered from later.
+type PledgeAction struct {
+	Amount Integer
+	Node   crypto.Key
+}
+
+type pledgeExtra struct {
+	Node crypto.Key `msgpack:"N"json:"node"`
+}
+
+func (a *PledgeAction) Apply(ctx context.Context, tpl *Template, source UTXOSource) error {
+	extra := MsgpackMarshalPanic(pledgeExtra{Node: a.Node})
+	if len(extra) > ExtraSizeLimit {
+		return fmt.Errorf("invalid pledge extra size %d", len(extra))
+	}
+	if err := tpl.SetExtra(extra); err != nil {
+		return err
+	}
+	tpl.Transaction.Outputs = append(tpl.Transaction.Outputs, &Output{Type: OutputTypePledge, Amount: a.Amount})
+	return nil
+}
+
+// WithdrawAction redeems Amount out of the chain to Address, an external
+// chain address optionally qualified by Tag, e.g. a memo or destination tag
+// some chains require alongside the address. Like PledgeAction, neither
+// field has a dedicated Output slot, so both travel in the transaction's
+// Extra.
+type WithdrawAction struct {
+	Amount  Integer
+	Address string
+	Tag     string
+}
+
+type withdrawExtra struct {
+	Address string `msgpack:"A"json:"address"`
+	Tag     string `msgpack:"T,omitempty"json:"tag,omitempty"`
+}
+
+func (a *WithdrawAction) Apply(ctx context.Context, tpl *Template, source UTXOSource) error {
+	extra := MsgpackMarshalPanic(withdrawExtra{Address: a.Address, Tag: a.Tag})
+	if len(extra) > ExtraSizeLimit {
+		return fmt.Errorf("invalid withdrawal extra size %d", len(extra))
+	}
+	if err := tpl.SetExtra(extra); err != nil {
+		return err
+	}
+	tpl.Transaction.Outputs = append(tpl.Transaction.Outputs, &Output{Type: OutputTypeWithdrawal, Amount: a.Amount})
+	return nil
+}
+
+// defaultChangeScript is the threshold applied to an automatically
+// generated change output, a plain single-signature spend.
+var defaultChangeScript = Script{OperatorCmp, OperatorSum, 1}
+
+// TxBuilder folds a sequence of high-level Actions into a fully signed
+// SignedTransaction, handling UTXO selection, change and per-input signing
+// so callers don't have to reimplement that bookkeeping themselves.
+type TxBuilder struct {
+	Asset   crypto.Hash
+	Actions []Action
+}
+
+func NewTxBuilder(asset crypto.Hash) *TxBuilder {
+	return &TxBuilder{Asset: asset}
+}
+
+func (b *TxBuilder) AddAction(a Action) {
+	b.Actions = append(b.Actions, a)
+}
+
+// Build applies every action in order (each SpendAction pays its own
+// change back to its own From), signs every gathered input, and returns
+// the fully signed transaction.
+func (b *TxBuilder) Build(ctx context.Context, source UTXOSource) (*SignedTransaction, error) {
+	tpl := &Template{
+		Transaction: NewTransaction(b.Asset),
+		utxos:       make(map[string]*UTXO),
+	}
+	for _, action := range b.Actions {
+		err := action.Apply(ctx, tpl, source)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var inputAmount, outputAmount Integer
+	for _, utxo := range tpl.utxos {
+		inputAmount = inputAmount.Add(utxo.Amount)
+	}
+	for _, o := range tpl.Transaction.Outputs {
+		outputAmount = outputAmount.Add(o.Amount)
+	}
+	if inputAmount.Cmp(outputAmount) != 0 {
+		return nil, fmt.Errorf("unbalanced transaction, inputs %s outputs %s", inputAmount.String(), outputAmount.String())
+	}
+
+	signed := &SignedTransaction{Transaction: *tpl.Transaction}
+	locker := func(hash crypto.Hash, index int, tx crypto.Hash, lock uint64) (*UTXO, error) {
+		return tpl.utxos[fmt.Sprintf("%s:%d", hash.String(), index)], nil
+	}
+	for i, accounts := range tpl.Signers {
+		err := signed.SignInput(locker, i, accounts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return signed, nil
+}
@@ -0,0 +1,168 @@
+package common
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"github.com/MixinNetwork/mixin/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeUTXOSource struct {
+	utxos []*UTXO
+}
+
+func (s *fakeUTXOSource) ListUnspent(ctx context.Context, asset crypto.Hash, accounts []Address) ([]*UTXO, error) {
+	return s.utxos, nil
+}
+
+func TestTxBuilder(t *testing.T) {
+	assert := assert.New(t)
+
+	from := randomAccount()
+	to := randomAccount()
+	script := Script{OperatorCmp, OperatorSum, 1}
+
+	seed := make([]byte, 64)
+	rand.Read(seed)
+	maskr := crypto.NewKeyFromSeed(seed)
+	maskR := maskr.Public()
+	key := crypto.DeriveGhostPublicKey(&maskr, &from.PublicViewKey, &from.PublicSpendKey)
+
+	source := &fakeUTXOSource{utxos: []*UTXO{
+		{
+			Input:  Input{Hash: crypto.Hash{}, Index: 0},
+			Output: Output{Type: OutputTypeScript, Amount: NewInteger(10000), Script: script, Mask: maskR, Keys: []crypto.Key{*key}},
+			Asset:  XINAssetId,
+		},
+	}}
+
+	builder := NewTxBuilder(XINAssetId)
+	builder.AddAction(&SpendAction{Asset: XINAssetId, Amount: NewInteger(7000), From: []Address{from}})
+	builder.AddAction(&SendAction{To: []Address{to}, Script: script, Amount: NewInteger(7000)})
+
+	signed, err := builder.Build(context.Background(), source)
+	assert.Nil(err)
+	if assert.NotNil(signed) {
+		assert.Len(signed.Inputs, 1)
+		assert.Len(signed.Outputs, 2, "a send plus a change output for the unspent remainder")
+		assert.Len(signed.Signatures, 1)
+
+		keyChecker := func(key crypto.Key) (bool, error) { return false, nil }
+		locker := func(hash crypto.Hash, index int, tx crypto.Hash, lock uint64) (*UTXO, error) {
+			return source.utxos[0], nil
+		}
+		assert.Nil(signed.Validate(locker, keyChecker))
+	}
+
+	insufficient := NewTxBuilder(XINAssetId)
+	insufficient.AddAction(&SpendAction{Asset: XINAssetId, Amount: NewInteger(20000), From: []Address{from}})
+	_, err = insufficient.Build(context.Background(), source)
+	assert.NotNil(err, "a spend exceeding the available unspent outputs must fail")
+}
+
+type perAccountUTXOSource struct {
+	utxos map[string][]*UTXO
+}
+
+func (s *perAccountUTXOSource) ListUnspent(ctx context.Context, asset crypto.Hash, accounts []Address) ([]*UTXO, error) {
+	return s.utxos[accounts[0].String()], nil
+}
+
+func utxoForAccount(account Address, amount Integer) *UTXO {
+	seed := make([]byte, 64)
+	rand.Read(seed)
+	maskr := crypto.NewKeyFromSeed(seed)
+	key := crypto.DeriveGhostPublicKey(&maskr, &account.PublicViewKey, &account.PublicSpendKey)
+	return &UTXO{
+		Input:  Input{Hash: crypto.NewHash(seed), Index: 0},
+		Output: Output{Type: OutputTypeScript, Amount: amount, Script: Script{OperatorCmp, OperatorSum, 1}, Mask: maskr.Public(), Keys: []crypto.Key{*key}},
+		Asset:  XINAssetId,
+	}
+}
+
+func TestTxBuilderMultipleSourcesChange(t *testing.T) {
+	assert := assert.New(t)
+
+	accountA := randomAccount()
+	accountB := randomAccount()
+	to := randomAccount()
+	script := Script{OperatorCmp, OperatorSum, 1}
+
+	utxoA := utxoForAccount(accountA, NewInteger(9000))
+	utxoB := utxoForAccount(accountB, NewInteger(6000))
+	source := &perAccountUTXOSource{utxos: map[string][]*UTXO{
+		accountA.String(): {utxoA},
+		accountB.String(): {utxoB},
+	}}
+
+	builder := NewTxBuilder(XINAssetId)
+	builder.AddAction(&SpendAction{Asset: XINAssetId, Amount: NewInteger(5000), From: []Address{accountA}})
+	builder.AddAction(&SpendAction{Asset: XINAssetId, Amount: NewInteger(4000), From: []Address{accountB}})
+	builder.AddAction(&SendAction{To: []Address{to}, Script: script, Amount: NewInteger(9000)})
+
+	signed, err := builder.Build(context.Background(), source)
+	assert.Nil(err)
+	if assert.NotNil(signed) {
+		assert.Len(signed.Inputs, 2)
+		// send(9000) + A's change(4000) + B's change(2000)
+		assert.Len(signed.Outputs, 3)
+
+		var changeToA, changeToB bool
+		for _, o := range signed.ViewGhostKey(&accountA.PrivateViewKey) {
+			if o.Amount.Cmp(NewInteger(4000)) == 0 && o.Keys[0].String() == accountA.PublicSpendKey.String() {
+				changeToA = true
+			}
+		}
+		for _, o := range signed.ViewGhostKey(&accountB.PrivateViewKey) {
+			if o.Amount.Cmp(NewInteger(2000)) == 0 && o.Keys[0].String() == accountB.PublicSpendKey.String() {
+				changeToB = true
+			}
+		}
+		assert.True(changeToA, "accountA's 4000 change must be paid back to accountA, not accountB")
+		assert.True(changeToB, "accountB's 2000 change must be paid back to accountB, not accountA")
+	}
+}
+
+func TestTxBuilderPledgeAndWithdraw(t *testing.T) {
+	assert := assert.New(t)
+
+	from := randomAccount()
+	seed := make([]byte, 64)
+	rand.Read(seed)
+	node := crypto.NewKeyFromSeed(seed).Public()
+
+	utxo := utxoForAccount(from, NewInteger(10000))
+	source := &perAccountUTXOSource{utxos: map[string][]*UTXO{from.String(): {utxo}}}
+
+	pledge := NewTxBuilder(XINAssetId)
+	pledge.AddAction(&SpendAction{Asset: XINAssetId, Amount: NewInteger(10000), From: []Address{from}})
+	pledge.AddAction(&PledgeAction{Amount: NewInteger(10000), Node: node})
+	signedPledge, err := pledge.Build(context.Background(), source)
+	assert.Nil(err)
+	if assert.NotNil(signedPledge) {
+		var decoded pledgeExtra
+		assert.Nil(MsgpackUnmarshal(signedPledge.Extra, &decoded))
+		assert.Equal(node.String(), decoded.Node.String())
+	}
+
+	withdraw := NewTxBuilder(XINAssetId)
+	withdraw.AddAction(&SpendAction{Asset: XINAssetId, Amount: NewInteger(10000), From: []Address{from}})
+	withdraw.AddAction(&WithdrawAction{Amount: NewInteger(10000), Address: "1BoatSLRHtKNngkdXEeobR76b53LETtpyT", Tag: "12345"})
+	signedWithdraw, err := withdraw.Build(context.Background(), source)
+	assert.Nil(err)
+	if assert.NotNil(signedWithdraw) {
+		var decoded withdrawExtra
+		assert.Nil(MsgpackUnmarshal(signedWithdraw.Extra, &decoded))
+		assert.Equal("1BoatSLRHtKNngkdXEeobR76b53LETtpyT", decoded.Address)
+		assert.Equal("12345", decoded.Tag)
+	}
+
+	conflict := NewTxBuilder(XINAssetId)
+	conflict.AddAction(&SpendAction{Asset: XINAssetId, Amount: NewInteger(10000), From: []Address{from}})
+	conflict.AddAction(&PledgeAction{Amount: NewInteger(10000), Node: node})
+	conflict.AddAction(&WithdrawAction{Amount: NewInteger(0), Address: "1BoatSLRHtKNngkdXEeobR76b53LETtpyT"})
+	_, err = conflict.Build(context.Background(), source)
+	assert.NotNil(err, "two actions both writing Extra in the same TxBuilder must fail loudly, not silently clobber each other")
+}
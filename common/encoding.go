@@ -0,0 +1,102 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Network identifies which chain a typed encoding's payload targets.
+const (
+	NetworkMainnet uint8 = 0x01
+	NetworkTestnet uint8 = 0x02
+)
+
+// Typed encoding prefixes, registered so DecodeTyped can reject anything it
+// does not recognize instead of guessing at unknown payload shapes.
+const (
+	TypedEncodingPrefixTransaction     = "mixin-tx"
+	TypedEncodingPrefixPaymentRequest  = "mixin-payreq"
+	TypedEncodingPrefixMultisigRequest = "mixin-multisig-req"
+)
+
+var typedEncodingPrefixes = map[string]bool{
+	TypedEncodingPrefixTransaction:     true,
+	TypedEncodingPrefixPaymentRequest:  true,
+	TypedEncodingPrefixMultisigRequest: true,
+}
+
+// EncodeTyped renders payload as a BIP276-inspired typed text form:
+// "<prefix>:<version_hex><network_hex><payload_hex><checksum_hex>", where
+// checksum is the first 4 bytes of sha256(sha256(prefix||version||network||payload)).
+// This gives wallets a URI-safe, copy-pasteable form that clearly
+// distinguishes mainnet/testnet and payload type.
+func EncodeTyped(prefix string, version, network uint8, payload []byte) string {
+	body := append([]byte{version, network}, payload...)
+	checksum := typedChecksum(prefix, body)
+	return fmt.Sprintf("%s:%s%s", prefix, hex.EncodeToString(body), hex.EncodeToString(checksum))
+}
+
+// DecodeTyped parses a string produced by EncodeTyped, rejecting an
+// unregistered prefix or a mismatched checksum.
+func DecodeTyped(s string) (prefix string, version, network uint8, payload []byte, err error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return "", 0, 0, nil, fmt.Errorf("invalid typed encoding %s", s)
+	}
+	prefix = parts[0]
+	if !typedEncodingPrefixes[prefix] {
+		return "", 0, 0, nil, fmt.Errorf("unknown typed encoding prefix %s", prefix)
+	}
+
+	raw, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return "", 0, 0, nil, fmt.Errorf("invalid typed encoding hex: %v", err)
+	}
+	if len(raw) < 2+4 {
+		return "", 0, 0, nil, fmt.Errorf("invalid typed encoding length %d", len(raw))
+	}
+
+	body, checksum := raw[:len(raw)-4], raw[len(raw)-4:]
+	expected := typedChecksum(prefix, body)
+	if hex.EncodeToString(checksum) != hex.EncodeToString(expected) {
+		return "", 0, 0, nil, fmt.Errorf("invalid typed encoding checksum")
+	}
+	return prefix, body[0], body[1], body[2:], nil
+}
+
+func typedChecksum(prefix string, body []byte) []byte {
+	first := sha256.Sum256(append([]byte(prefix), body...))
+	second := sha256.Sum256(first[:])
+	return second[:4]
+}
+
+// EncodeText renders the transaction as a "mixin-tx:..." typed text string
+// for the given network, suitable for copy-paste transport outside of a
+// binary msgpack channel.
+func (tx *SignedTransaction) EncodeText(network uint8) string {
+	return EncodeTyped(TypedEncodingPrefixTransaction, tx.Version, network, tx.Marshal())
+}
+
+// DecodeSignedTransactionText parses a "mixin-tx:..." string produced by
+// EncodeText, returning the decoded transaction and the network it targets.
+func DecodeSignedTransactionText(s string) (*SignedTransaction, uint8, error) {
+	prefix, version, network, payload, err := DecodeTyped(s)
+	if err != nil {
+		return nil, 0, err
+	}
+	if prefix != TypedEncodingPrefixTransaction {
+		return nil, 0, fmt.Errorf("invalid typed encoding prefix %s for a transaction", prefix)
+	}
+	if version != TxVersion {
+		return nil, 0, fmt.Errorf("invalid typed transaction version %d", version)
+	}
+
+	var tx SignedTransaction
+	err = MsgpackUnmarshal(payload, &tx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &tx, network, nil
+}
@@ -0,0 +1,53 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/MixinNetwork/mixin/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypedEncoding(t *testing.T) {
+	assert := assert.New(t)
+
+	s := EncodeTyped(TypedEncodingPrefixPaymentRequest, 1, NetworkMainnet, []byte("hello"))
+	assert.True(len(s) > len(TypedEncodingPrefixPaymentRequest)+1)
+
+	prefix, version, network, payload, err := DecodeTyped(s)
+	assert.Nil(err)
+	assert.Equal(TypedEncodingPrefixPaymentRequest, prefix)
+	assert.Equal(uint8(1), version)
+	assert.Equal(NetworkMainnet, network)
+	assert.Equal("hello", string(payload))
+
+	_, _, _, _, err = DecodeTyped("mixin-unknown:00")
+	assert.NotNil(err, "an unregistered prefix must be rejected")
+
+	corrupted := s[:len(s)-1] + "0"
+	_, _, _, _, err = DecodeTyped(corrupted)
+	assert.NotNil(err, "a mismatched checksum must be rejected")
+}
+
+func TestSignedTransactionText(t *testing.T) {
+	assert := assert.New(t)
+
+	accounts := make([]Address, 0)
+	for i := 0; i < 1; i++ {
+		accounts = append(accounts, randomAccount())
+	}
+	script := Script{OperatorCmp, OperatorSum, 1}
+
+	tx := NewTransaction(XINAssetId)
+	tx.AddInput(crypto.Hash{}, 0)
+	assert.Nil(tx.AddScriptOutput(accounts, script, NewInteger(10000)))
+	signed := &SignedTransaction{Transaction: *tx}
+
+	text := signed.EncodeText(NetworkTestnet)
+	decoded, network, err := DecodeSignedTransactionText(text)
+	assert.Nil(err)
+	assert.Equal(NetworkTestnet, network)
+	assert.Equal(signed.Hash(), decoded.Hash())
+
+	_, _, err = DecodeSignedTransactionText(EncodeTyped(TypedEncodingPrefixPaymentRequest, TxVersion, NetworkMainnet, signed.Marshal()))
+	assert.NotNil(err, "a payment-request-prefixed string must not decode as a transaction")
+}
@@ -13,21 +13,35 @@ const (
 	TxVersion      = 0x01
 	ExtraSizeLimit = 256
 
-	InputTypeScript  = 0x00
-	InputTypeDeposit = 0x71
-	InputTypeRebate  = 0x72
-	InputTypeMint    = 0x73
-
-	OutputTypeScript     = 0x00
-	OutputTypeWithdrawal = 0xa1
-	OutputTypeSlash      = 0xa2
-	OutputTypePledge     = 0xa3
-	OutputTypeReclaim    = 0xa4
+	InputTypeScript     = 0x00
+	InputTypeDeposit    = 0x71
+	InputTypeRebate     = 0x72
+	InputTypeMint       = 0x73
+	InputTypeVoteRevoke = 0x74
+
+	OutputTypeScript         = 0x00
+	OutputTypeWithdrawal     = 0xa1
+	OutputTypeSlash          = 0xa2
+	OutputTypePledge         = 0xa3
+	OutputTypeReclaim        = 0xa4
+	OutputTypeVote           = 0xa5
+	OutputTypeMultisigRotate = 0xa6
 )
 
+// VoteEpoch is the minimum duration a staked OutputTypeVote must remain
+// locked before its owner may revoke it. It is a var rather than a const so
+// test and staging networks can shorten the epoch.
+var VoteEpoch = 365 * 24 * time.Hour
+
 type Input struct {
 	Hash  crypto.Hash `msgpack:"H"json:"hash"`
 	Index int         `msgpack:"I"json:"index"`
+
+	// Action tags a non-default way of consuming the referenced output,
+	// e.g. InputTypeVoteRevoke to unlock an OutputTypeVote. The zero value
+	// is a plain spend. Named Action rather than Type to avoid colliding
+	// with the embedding UTXO's promoted Output.Type.
+	Action uint8 `msgpack:"P,omitempty"json:"action,omitempty"`
 }
 
 type Output struct {
@@ -38,6 +52,17 @@ type Output struct {
 	Script Script       `msgpack:"S,omitempty"json:"script,omitempty"`
 	Keys   []crypto.Key `msgpack:"K,omitempty"json:"keys,omitempty"`
 	Mask   crypto.Key   `msgpack:"M,omitempty"json:"mask,omitempty"`
+
+	// OutputTypeVote fields, the validator this output's amount is staked to
+	Votee crypto.Hash `msgpack:"V,omitempty"json:"votee,omitempty"`
+
+	// OutputTypeMultisigRotate fields, the key set and threshold that
+	// replaces the consumed input's script for this output's amount. A
+	// rotate output is spendable under NewKeys/NewScript/NewMask, never
+	// under Keys/Script/Mask.
+	NewKeys   []crypto.Key `msgpack:"NK,omitempty"json:"new_keys,omitempty"`
+	NewScript Script       `msgpack:"NS,omitempty"json:"new_script,omitempty"`
+	NewMask   crypto.Key   `msgpack:"NM,omitempty"json:"new_mask,omitempty"`
 }
 
 type Transaction struct {
@@ -77,7 +102,25 @@ func (tx *Transaction) ViewGhostKey(a *crypto.Key) []*Output {
 	return outputs
 }
 
+// PendingUTXOResolver looks up an output produced by a transaction that has
+// not yet been confirmed onto the chain, e.g. an earlier transaction in the
+// same batch. It returns a nil UTXO, nil error when the output is unknown so
+// callers can fall back to the confirmed UTXO set.
+type PendingUTXOResolver func(hash crypto.Hash, index int) (*UTXO, error)
+
 func (tx *SignedTransaction) Validate(lockUTXOForTransaction UTXOLocker, checkGhost GhostChecker) error {
+	return tx.validate(lockUTXOForTransaction, checkGhost, nil)
+}
+
+// ValidatePending behaves like Validate, but first consults pending for each
+// input, allowing a transaction to spend outputs of other not-yet-confirmed
+// transactions, e.g. when validating a Batch. When pending resolves an
+// input, the confirmed UTXO set is never locked for it.
+func (tx *SignedTransaction) ValidatePending(lockUTXOForTransaction UTXOLocker, checkGhost GhostChecker, pending PendingUTXOResolver) error {
+	return tx.validate(lockUTXOForTransaction, checkGhost, pending)
+}
+
+func (tx *SignedTransaction) validate(lockUTXOForTransaction UTXOLocker, checkGhost GhostChecker, pending PendingUTXOResolver) error {
 	if tx.Version != TxVersion {
 		return fmt.Errorf("invalid tx version %d", tx.Version)
 	}
@@ -111,6 +154,22 @@ func (tx *SignedTransaction) Validate(lockUTXOForTransaction UTXOLocker, checkGh
 				return fmt.Errorf("invalid output key %s", k.String())
 			}
 		}
+		if o.Type == OutputTypeVote {
+			if len(tx.Inputs) != 1 || len(tx.Outputs) != 1 {
+				return fmt.Errorf("vote output must be the sole input and output of its transaction")
+			}
+			if o.Votee.String() == (crypto.Hash{}).String() {
+				return fmt.Errorf("invalid vote output without a votee")
+			}
+		}
+		if o.Type == OutputTypeMultisigRotate {
+			if len(tx.Inputs) != 1 || len(tx.Outputs) != 1 {
+				return fmt.Errorf("multisig rotate output must be the sole input and output of its transaction")
+			}
+			if len(o.NewKeys) == 0 {
+				return fmt.Errorf("invalid multisig rotate output without new keys")
+			}
+		}
 		outputAmount = outputAmount.Add(o.Amount)
 	}
 
@@ -122,10 +181,20 @@ func (tx *SignedTransaction) Validate(lockUTXOForTransaction UTXOLocker, checkGh
 		}
 		inputsFilter[fk] = true
 
-		lockUntil := time.Now().Add(time.Duration(config.SnapshotRoundGap * 3)).UnixNano()
-		utxo, err := lockUTXOForTransaction(in.Hash, in.Index, tx.Hash(), uint64(lockUntil))
-		if err != nil {
-			return err
+		var utxo *UTXO
+		var err error
+		if pending != nil {
+			utxo, err = pending(in.Hash, in.Index)
+			if err != nil {
+				return err
+			}
+		}
+		if utxo == nil {
+			lockUntil := time.Now().Add(time.Duration(config.SnapshotRoundGap * 3)).UnixNano()
+			utxo, err = lockUTXOForTransaction(in.Hash, in.Index, tx.Hash(), uint64(lockUntil))
+			if err != nil {
+				return err
+			}
 		}
 		if utxo == nil {
 			return fmt.Errorf("input not found %s:%d", in.Hash.String(), in.Index)
@@ -133,6 +202,12 @@ func (tx *SignedTransaction) Validate(lockUTXOForTransaction UTXOLocker, checkGh
 		if utxo.Asset.String() != tx.Asset.String() {
 			return fmt.Errorf("invalid input asset %s %s", utxo.Asset.String(), tx.Asset.String())
 		}
+		if utxo.Type == OutputTypeVote && in.Action != InputTypeVoteRevoke {
+			return fmt.Errorf("vote output %s:%d must be spent by a revoke input", in.Hash.String(), in.Index)
+		}
+		if in.Action == InputTypeVoteRevoke && utxo.Type != OutputTypeVote {
+			return fmt.Errorf("revoke input %s:%d must spend a vote output", in.Hash.String(), in.Index)
+		}
 
 		err = validateUTXO(utxo, tx.Signatures[i], msg)
 		if err != nil {
@@ -149,13 +224,21 @@ func (tx *SignedTransaction) Validate(lockUTXOForTransaction UTXOLocker, checkGh
 }
 
 func validateUTXO(utxo *UTXO, sigs []crypto.Signature, msg []byte) error {
-	if utxo.Type != InputTypeScript {
+	switch utxo.Type {
+	case InputTypeScript, OutputTypeMultisigRotate:
+	case OutputTypeVote:
+		if uint64(time.Now().UnixNano()) < utxo.Lock {
+			return fmt.Errorf("vote output still locked until %d", utxo.Lock)
+		}
+	default:
 		return fmt.Errorf("invalid input type %d", utxo.Type)
 	}
 
+	keys, _, script := utxoSpendMaterial(utxo)
+
 	var offset, valid int
 	for _, sig := range sigs {
-		for i, k := range utxo.Keys {
+		for i, k := range keys {
 			if i < offset {
 				continue
 			}
@@ -166,7 +249,32 @@ func validateUTXO(utxo *UTXO, sigs []crypto.Signature, msg []byte) error {
 		}
 	}
 
-	return utxo.Script.Validate(valid)
+	return script.Validate(valid)
+}
+
+// pendingOutputLock computes the Lock a UTXO must carry when it is
+// reconstructed directly from an Output that has not yet passed through the
+// confirmed UTXO pool, e.g. a Batch sibling's output or a Bundle ancestor's
+// output. The confirmed pool stamps every OutputTypeVote output with
+// creation time plus VoteEpoch when it is written, so any other site that
+// materializes a *UTXO from a raw *Output must reproduce the same lock or a
+// vote output could be revoked immediately through that path.
+func pendingOutputLock(o *Output) uint64 {
+	if o.Type != OutputTypeVote {
+		return 0
+	}
+	return uint64(time.Now().Add(VoteEpoch).UnixNano())
+}
+
+// utxoSpendMaterial returns the keys, mask and script that authorize
+// spending utxo. A multisig rotate output is spendable under its new key
+// set, mask and threshold, never under the Keys/Mask/Script it also
+// carries.
+func utxoSpendMaterial(utxo *UTXO) ([]crypto.Key, crypto.Key, Script) {
+	if utxo.Type == OutputTypeMultisigRotate {
+		return utxo.NewKeys, utxo.NewMask, utxo.NewScript
+	}
+	return utxo.Keys, utxo.Mask, utxo.Script
 }
 
 func (tx *Transaction) Hash() crypto.Hash {
@@ -179,28 +287,51 @@ func (tx *SignedTransaction) Marshal() []byte {
 }
 
 func (signed *SignedTransaction) SignInput(lockUTXOForTransaction UTXOLocker, index int, accounts []Address) error {
+	return signed.signInput(lockUTXOForTransaction, index, accounts, nil)
+}
+
+// SignInputPending behaves like SignInput, but first consults pending for
+// the input's UTXO, allowing a transaction to be signed against an output
+// of another not-yet-confirmed transaction in the same Batch.
+func (signed *SignedTransaction) SignInputPending(lockUTXOForTransaction UTXOLocker, index int, accounts []Address, pending PendingUTXOResolver) error {
+	return signed.signInput(lockUTXOForTransaction, index, accounts, pending)
+}
+
+func (signed *SignedTransaction) signInput(lockUTXOForTransaction UTXOLocker, index int, accounts []Address, pending PendingUTXOResolver) error {
 	msg := MsgpackMarshalPanic(signed.Transaction)
 
 	if index >= len(signed.Inputs) {
 		return fmt.Errorf("invalid input index %d/%d", index, len(signed.Inputs))
 	}
 	in := signed.Inputs[index]
-	utxo, err := lockUTXOForTransaction(in.Hash, in.Index, crypto.Hash{}, 0)
-	if err != nil {
-		return err
+
+	var utxo *UTXO
+	var err error
+	if pending != nil {
+		utxo, err = pending(in.Hash, in.Index)
+		if err != nil {
+			return err
+		}
+	}
+	if utxo == nil {
+		utxo, err = lockUTXOForTransaction(in.Hash, in.Index, crypto.Hash{}, 0)
+		if err != nil {
+			return err
+		}
 	}
 	if utxo == nil {
 		return fmt.Errorf("input not found %s:%d", in.Hash.String(), in.Index)
 	}
 
+	keys, mask, _ := utxoSpendMaterial(utxo)
 	keysFilter := make(map[string]bool)
-	for _, k := range utxo.Keys {
+	for _, k := range keys {
 		keysFilter[k.String()] = true
 	}
 
 	sigs := make([]crypto.Signature, 0)
 	for _, acc := range accounts {
-		priv := crypto.DeriveGhostPrivateKey(&utxo.Mask, &acc.PrivateViewKey, &acc.PrivateSpendKey)
+		priv := crypto.DeriveGhostPrivateKey(&mask, &acc.PrivateViewKey, &acc.PrivateSpendKey)
 		if keysFilter[priv.Public().String()] {
 			sigs = append(sigs, priv.Sign(msg))
 		}
@@ -224,6 +355,17 @@ func (tx *Transaction) AddInput(hash crypto.Hash, index int) {
 	tx.Inputs = append(tx.Inputs, in)
 }
 
+// AddRevokeInput spends the OutputTypeVote output at hash:index, unlocking
+// its staked amount once VoteEpoch has elapsed since it was created.
+func (tx *Transaction) AddRevokeInput(hash crypto.Hash, index int) {
+	in := &Input{
+		Hash:   hash,
+		Index:  index,
+		Action: InputTypeVoteRevoke,
+	}
+	tx.Inputs = append(tx.Inputs, in)
+}
+
 func (tx *Transaction) AddScriptOutput(accounts []Address, s Script, amount Integer) error {
 	seed := make([]byte, 64)
 	_, err := rand.Read(seed)
@@ -247,3 +389,57 @@ func (tx *Transaction) AddScriptOutput(accounts []Address, s Script, amount Inte
 	tx.Outputs = append(tx.Outputs, out)
 	return nil
 }
+
+// AddVoteOutput stakes amount to votee, locking it for at least VoteEpoch.
+// A vote output must be the sole input and output of its transaction, so it
+// can only be created by spending a single UTXO of the same amount.
+func (tx *Transaction) AddVoteOutput(account Address, s Script, votee crypto.Hash, amount Integer) error {
+	seed := make([]byte, 64)
+	_, err := rand.Read(seed)
+	if err != nil {
+		return err
+	}
+	r := crypto.NewKeyFromSeed(seed)
+	R := r.Public()
+	k := crypto.DeriveGhostPublicKey(&r, &account.PublicViewKey, &account.PublicSpendKey)
+	out := &Output{
+		Type:   OutputTypeVote,
+		Amount: amount,
+		Script: s,
+		Mask:   R,
+		Keys:   []crypto.Key{*k},
+		Votee:  votee,
+	}
+	tx.Outputs = append(tx.Outputs, out)
+	return nil
+}
+
+// AddRotateOutput atomically transfers ownership of amount from oldAccounts
+// to newAccounts under newScript's threshold, without moving funds off-chain
+// and back on-chain. oldAccounts is accepted for symmetry with the spent
+// input's signers, it is not itself encoded in the output. A rotate output
+// must be the sole input and output of its transaction, so amount must
+// exactly equal the spent input's amount.
+func (tx *Transaction) AddRotateOutput(oldAccounts, newAccounts []Address, newScript Script, amount Integer) error {
+	seed := make([]byte, 64)
+	_, err := rand.Read(seed)
+	if err != nil {
+		return err
+	}
+	r := crypto.NewKeyFromSeed(seed)
+	R := r.Public()
+	out := &Output{
+		Type:      OutputTypeMultisigRotate,
+		Amount:    amount,
+		NewScript: newScript,
+		NewMask:   R,
+		NewKeys:   make([]crypto.Key, 0),
+	}
+
+	for _, a := range newAccounts {
+		k := crypto.DeriveGhostPublicKey(&r, &a.PublicViewKey, &a.PublicSpendKey)
+		out.NewKeys = append(out.NewKeys, *k)
+	}
+	tx.Outputs = append(tx.Outputs, out)
+	return nil
+}
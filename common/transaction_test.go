@@ -3,6 +3,7 @@ package common
 import (
 	"crypto/rand"
 	"testing"
+	"time"
 
 	"github.com/MixinNetwork/mixin/crypto"
 	"github.com/stretchr/testify/assert"
@@ -73,6 +74,165 @@ func TestTransaction(t *testing.T) {
 	assert.NotEqual(outputs[0].Keys[1].String(), accounts[1].PublicViewKey.String())
 }
 
+func TestVote(t *testing.T) {
+	assert := assert.New(t)
+
+	account := randomAccount()
+	votee := crypto.NewHash([]byte("validator"))
+	script := Script{OperatorCmp, OperatorSum, 1}
+
+	seed := make([]byte, 64)
+	rand.Read(seed)
+	stakeHash := crypto.Hash{}
+
+	keyChecker := func(key crypto.Key) (bool, error) {
+		return false, nil
+	}
+
+	scriptLocker := func(hash crypto.Hash, index int, tx crypto.Hash, lock uint64) (*UTXO, error) {
+		maskr := crypto.NewKeyFromSeed(seed)
+		maskR := maskr.Public()
+		in := Input{Hash: hash, Index: index}
+		out := Output{Type: OutputTypeScript, Amount: NewInteger(10000), Script: script, Mask: maskR}
+		utxo := &UTXO{Input: in, Output: out, Asset: XINAssetId}
+		key := crypto.DeriveGhostPublicKey(&maskr, &account.PublicViewKey, &account.PublicSpendKey)
+		utxo.Keys = append(utxo.Keys, *key)
+		return utxo, nil
+	}
+
+	tx := NewTransaction(XINAssetId)
+	tx.AddInput(stakeHash, 0)
+	assert.Nil(tx.AddVoteOutput(account, script, votee, NewInteger(10000)))
+	signed := &SignedTransaction{Transaction: *tx}
+	assert.Nil(signed.SignInput(scriptLocker, 0, []Address{account}))
+	assert.Nil(signed.Validate(scriptLocker, keyChecker))
+	voteUTXOHash := signed.Hash()
+
+	lockedVoteLocker := func(hash crypto.Hash, index int, tx crypto.Hash, lock uint64) (*UTXO, error) {
+		maskr := crypto.NewKeyFromSeed(seed)
+		maskR := maskr.Public()
+		in := Input{Hash: hash, Index: index}
+		out := Output{Type: OutputTypeVote, Amount: NewInteger(10000), Script: script, Mask: maskR, Votee: votee}
+		utxo := &UTXO{Input: in, Output: out, Asset: XINAssetId}
+		utxo.Lock = uint64(time.Now().Add(VoteEpoch).UnixNano())
+		key := crypto.DeriveGhostPublicKey(&maskr, &account.PublicViewKey, &account.PublicSpendKey)
+		utxo.Keys = append(utxo.Keys, *key)
+		return utxo, nil
+	}
+
+	revoke := NewTransaction(XINAssetId)
+	revoke.AddRevokeInput(voteUTXOHash, 0)
+	assert.Nil(revoke.AddScriptOutput([]Address{account}, script, NewInteger(10000)))
+	signedRevoke := &SignedTransaction{Transaction: *revoke}
+	assert.Nil(signedRevoke.SignInput(lockedVoteLocker, 0, []Address{account}))
+	err := signedRevoke.Validate(lockedVoteLocker, keyChecker)
+	assert.NotNil(err, "revoking a vote before its epoch elapses must be rejected")
+
+	plainSpend := NewTransaction(XINAssetId)
+	plainSpend.AddInput(voteUTXOHash, 0)
+	assert.Nil(plainSpend.AddScriptOutput([]Address{account}, script, NewInteger(10000)))
+	signedPlainSpend := &SignedTransaction{Transaction: *plainSpend}
+	assert.Nil(signedPlainSpend.SignInput(lockedVoteLocker, 0, []Address{account}))
+	err = signedPlainSpend.Validate(lockedVoteLocker, keyChecker)
+	assert.NotNil(err, "a vote output must only be spendable via a revoke input, not a plain spend")
+
+	misusedRevoke := NewTransaction(XINAssetId)
+	misusedRevoke.AddRevokeInput(stakeHash, 0)
+	assert.Nil(misusedRevoke.AddScriptOutput([]Address{account}, script, NewInteger(10000)))
+	signedMisusedRevoke := &SignedTransaction{Transaction: *misusedRevoke}
+	assert.Nil(signedMisusedRevoke.SignInput(scriptLocker, 0, []Address{account}))
+	err = signedMisusedRevoke.Validate(scriptLocker, keyChecker)
+	assert.NotNil(err, "a revoke input must only spend a vote output")
+
+	expiredVoteLocker := func(hash crypto.Hash, index int, tx crypto.Hash, lock uint64) (*UTXO, error) {
+		utxo, _ := lockedVoteLocker(hash, index, tx, lock)
+		utxo.Lock = uint64(time.Now().Add(-time.Hour).UnixNano())
+		return utxo, nil
+	}
+	signedRevoke2 := &SignedTransaction{Transaction: *revoke}
+	assert.Nil(signedRevoke2.SignInput(expiredVoteLocker, 0, []Address{account}))
+	assert.Nil(signedRevoke2.Validate(expiredVoteLocker, keyChecker))
+
+	spentLocker := func(hash crypto.Hash, index int, tx crypto.Hash, lock uint64) (*UTXO, error) {
+		return nil, nil
+	}
+	revote := NewTransaction(XINAssetId)
+	revote.AddInput(stakeHash, 0)
+	assert.Nil(revote.AddVoteOutput(account, script, votee, NewInteger(10000)))
+	signedRevote := &SignedTransaction{Transaction: *revote}
+	err = signedRevote.SignInput(spentLocker, 0, []Address{account})
+	assert.NotNil(err, "voting again on an already spent UTXO must be rejected")
+}
+
+func TestMultisigRotate(t *testing.T) {
+	assert := assert.New(t)
+
+	oldAccounts := make([]Address, 0)
+	for i := 0; i < 2; i++ {
+		oldAccounts = append(oldAccounts, randomAccount())
+	}
+	newAccount := randomAccount()
+	oldScript := Script{OperatorCmp, OperatorSum, 2}
+	newScript := Script{OperatorCmp, OperatorSum, 1}
+
+	seed := make([]byte, 64)
+	rand.Read(seed)
+	genesisHash := crypto.Hash{}
+
+	keyChecker := func(key crypto.Key) (bool, error) {
+		return false, nil
+	}
+	oldLocker := func(hash crypto.Hash, index int, tx crypto.Hash, lock uint64) (*UTXO, error) {
+		maskr := crypto.NewKeyFromSeed(seed)
+		maskR := maskr.Public()
+		in := Input{Hash: hash, Index: index}
+		out := Output{Type: OutputTypeScript, Amount: NewInteger(10000), Script: oldScript, Mask: maskR}
+		utxo := &UTXO{Input: in, Output: out, Asset: XINAssetId}
+		for _, a := range oldAccounts {
+			key := crypto.DeriveGhostPublicKey(&maskr, &a.PublicViewKey, &a.PublicSpendKey)
+			utxo.Keys = append(utxo.Keys, *key)
+		}
+		return utxo, nil
+	}
+
+	buildRotate := func(amount Integer) *Transaction {
+		tx := NewTransaction(XINAssetId)
+		tx.AddInput(genesisHash, 0)
+		assert.Nil(tx.AddRotateOutput(oldAccounts, []Address{newAccount}, newScript, amount))
+		return tx
+	}
+
+	happy := buildRotate(NewInteger(10000))
+	signedHappy := &SignedTransaction{Transaction: *happy}
+	assert.Nil(signedHappy.SignInput(oldLocker, 0, oldAccounts))
+	assert.Nil(signedHappy.Validate(oldLocker, keyChecker))
+
+	insufficient := buildRotate(NewInteger(10000))
+	signedInsufficient := &SignedTransaction{Transaction: *insufficient}
+	assert.Nil(signedInsufficient.SignInput(oldLocker, 0, oldAccounts[:1]))
+	err := signedInsufficient.Validate(oldLocker, keyChecker)
+	assert.NotNil(err, "a rotate signed by less than the old script's threshold must be rejected")
+
+	mutated := buildRotate(NewInteger(9999))
+	signedMutated := &SignedTransaction{Transaction: *mutated}
+	assert.Nil(signedMutated.SignInput(oldLocker, 0, oldAccounts))
+	err = signedMutated.Validate(oldLocker, keyChecker)
+	assert.NotNil(err, "a rotate that changes the value must be rejected")
+
+	rotatedHash := signedHappy.Hash()
+	newLocker := func(hash crypto.Hash, index int, tx crypto.Hash, lock uint64) (*UTXO, error) {
+		in := Input{Hash: hash, Index: index}
+		utxo := &UTXO{Input: in, Output: *signedHappy.Outputs[0], Asset: XINAssetId}
+		return utxo, nil
+	}
+	spend := NewTransaction(XINAssetId)
+	spend.AddInput(rotatedHash, 0)
+	assert.Nil(spend.AddScriptOutput([]Address{newAccount}, newScript, NewInteger(10000)))
+	signedSpend := &SignedTransaction{Transaction: *spend}
+	assert.Nil(signedSpend.SignInput(newLocker, 0, []Address{newAccount}))
+	assert.Nil(signedSpend.Validate(newLocker, keyChecker), "the new key set must be able to spend the rotated output")
+}
+
 func randomAccount() Address {
 	seed := make([]byte, 64)
 	rand.Read(seed)